@@ -2,12 +2,19 @@ package mercury
 
 import (
 	"bufio"
+	"errors"
 	"io"
+	"math"
+	"net"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// ErrLimitReached is returned by Write and WriteAndFlush once the configured
+// hard byte limit has been exceeded.
+var ErrLimitReached = errors.New("limit reached")
+
 var initiated uint64
 var executed uint64
 var extended uint64
@@ -31,7 +38,7 @@ func (s Stats) Sub(ss Stats) Stats {
 	}
 }
 
-// GetStats returns runtime statistics.
+// GetStats returns the aggregate runtime statistics of all writers.
 func GetStats() Stats {
 	return Stats{
 		Initiated: atomic.LoadUint64(&initiated),
@@ -41,6 +48,33 @@ func GetStats() Stats {
 	}
 }
 
+// MetricsCollector receives lifecycle events from a Writer for observability
+// purposes. Implementations must be safe for concurrent use, as methods may
+// be called from both the calling goroutine and the asynchronous flusher.
+type MetricsCollector interface {
+	// ObserveInitiate is called when the flush timer is armed.
+	ObserveInitiate()
+
+	// ObserveExtend is called when the flush timer is extended because data
+	// was flushed while it was armed.
+	ObserveExtend()
+
+	// ObserveCancel is called when the flush timer is cancelled because the
+	// buffer emptied before it fired.
+	ObserveCancel()
+
+	// ObserveFlush is called after every flush requested via Flush,
+	// WriteAndFlush or WriteBuffersAndFlush, caused by a zero delay or
+	// triggered by the flush timer, with the time elapsed since the flush
+	// timer was armed (zero if it was not armed) and the number of bytes that
+	// were flushed. Flushes that happen inside a write because the buffer
+	// overflowed, and the final flush performed by Close, are not reported.
+	ObserveFlush(delay time.Duration, bytes int)
+
+	// ObserveError is called whenever a write or flush fails.
+	ObserveError(err error)
+}
+
 // Writer extends a buffered writer that flushes itself asynchronously. It uses
 // a timer to flush the buffered writer if it gets stale. Errors that occur
 // during and asynchronous flush are returned on the next call to Write, Flush
@@ -51,34 +85,138 @@ type Writer struct {
 	writer *bufio.Writer
 	timer  *time.Timer
 	armed  bool
+	closed bool
 	err    error
 	mutex  sync.Mutex
+
+	adaptive bool
+	minDelay int64
+	maxDelay int64
+
+	rate   int64
+	burst  int64
+	tokens int64
+	last   int64
+
+	limit int64
+	used  int64
+
+	target io.Writer
+	pool   *BufferPool
+
+	armedAt   time.Time
+	collector MetricsCollector
+
+	initiated uint64
+	executed  uint64
+	extended  uint64
+	cancelled uint64
+}
+
+// WriterOptions configures a Writer created with NewWriterWithOptions.
+type WriterOptions struct {
+	// MaxDelay is the maximum delay of asynchronous flushes.
+	MaxDelay time.Duration
+
+	// Size configures the initial buffer size, rounded up to the next power
+	// of two. Zero uses defaultBufSize.
+	Size int
+
+	// Pool is the BufferPool the underlying buffer is acquired from and
+	// released back to on Close. A nil Pool uses the shared default pool.
+	Pool *BufferPool
+
+	// Collector, if set, receives lifecycle events for this Writer.
+	Collector MetricsCollector
+
+	// Adaptive enables self-tuning of the flush delay between MinDelay and
+	// MaxDelay based on observed flush pressure: the delay is halved when the
+	// buffer tends to fill up before the timer fires and grown when it tends
+	// to stay mostly empty. The current delay can be read with CurrentDelay.
+	Adaptive bool
+
+	// MinDelay is the lower bound of the flush delay when Adaptive is
+	// enabled. It is also used as the step size when growing the delay. It is
+	// clamped up to 1ms, matching the minimum recommended for MaxDelay,
+	// since the delay should not be below 1ms to prevent flushing every
+	// write asynchronously.
+	MinDelay time.Duration
 }
 
+// defaultBufSize is the buffer size used by NewWriter, matching the default
+// used by bufio.NewWriter.
+const defaultBufSize = 4096
+
+// defaultPool is the BufferPool shared by NewWriter and NewWriterSize.
+var defaultPool = NewBufferPool()
+
 // NewWriter wraps the provided writer and enables buffering and asynchronous
-// flushing using the specified maximum delay.
+// flushing using the specified maximum delay. The underlying buffer is
+// acquired from a shared pool and released again on Close.
 //
 // Note: The delay should not be below 1ms to prevent flushing every write
 // asynchronously.
 func NewWriter(w io.Writer, maxDelay time.Duration) *Writer {
-	return newWriter(bufio.NewWriter(w), maxDelay)
+	return NewWriterWithOptions(w, WriterOptions{MaxDelay: maxDelay})
 }
 
 // NewWriterSize wraps the provided writer and enables buffering and asynchronous
 // flushing using the specified maximum delay. This method allows configuration
-// of the initial buffer size.
+// of the initial buffer size, which is rounded up to the next power of two.
+// The underlying buffer is acquired from a shared pool and released again on
+// Close.
 //
 // Note: The delay should not be below 1ms to prevent flushing every write
 // asynchronously.
 func NewWriterSize(w io.Writer, maxDelay time.Duration, size int) *Writer {
-	return newWriter(bufio.NewWriterSize(w, size), maxDelay)
+	return NewWriterWithOptions(w, WriterOptions{MaxDelay: maxDelay, Size: size})
+}
+
+// NewWriterPooled wraps the provided writer like NewWriter but acquires its
+// underlying buffer from the supplied pool instead of the shared default
+// pool. This is useful for applications that create many short-lived writers
+// (e.g. per-connection in a server) and want to scope the pool accordingly.
+func NewWriterPooled(w io.Writer, maxDelay time.Duration, pool *BufferPool) *Writer {
+	return NewWriterWithOptions(w, WriterOptions{MaxDelay: maxDelay, Pool: pool})
+}
+
+// NewWriterWithOptions wraps the provided writer like NewWriter but allows
+// full configuration of the buffer size, buffer pool and metrics collector
+// via opts.
+//
+// Note: MaxDelay should not be below 1ms to prevent flushing every write
+// asynchronously.
+func NewWriterWithOptions(w io.Writer, opts WriterOptions) *Writer {
+	size := opts.Size
+	if size <= 0 {
+		size = defaultBufSize
+	}
+
+	pool := opts.Pool
+	if pool == nil {
+		pool = defaultPool
+	}
+
+	return newWriter(w, pool.get(w, size), opts.MaxDelay, pool, opts.Collector, opts.Adaptive, opts.MinDelay)
 }
 
-func newWriter(w *bufio.Writer, maxDelay time.Duration) *Writer {
+func newWriter(target io.Writer, w *bufio.Writer, maxDelay time.Duration, pool *BufferPool, collector MetricsCollector, adaptive bool, minDelay time.Duration) *Writer {
+	// clamp MinDelay to the documented floor so a repeatedly halved adaptive
+	// delay can't reach zero and turn every write into a synchronous flush
+	if adaptive && minDelay < time.Millisecond {
+		minDelay = time.Millisecond
+	}
+
 	// create writer
 	writer := &Writer{
-		writer: w,
-		delay:  int64(maxDelay),
+		writer:    w,
+		delay:     int64(maxDelay),
+		target:    target,
+		pool:      pool,
+		collector: collector,
+		adaptive:  adaptive,
+		minDelay:  int64(minDelay),
+		maxDelay:  int64(maxDelay),
 	}
 
 	// create stopped timer
@@ -88,9 +226,52 @@ func newWriter(w *bufio.Writer, maxDelay time.Duration) *Writer {
 	return writer
 }
 
+// Stats returns the runtime statistics for this Writer.
+func (w *Writer) Stats() Stats {
+	return Stats{
+		Initiated: atomic.LoadUint64(&w.initiated),
+		Executed:  atomic.LoadUint64(&w.executed),
+		Extended:  atomic.LoadUint64(&w.extended),
+		Cancelled: atomic.LoadUint64(&w.cancelled),
+	}
+}
+
+// Close flushes the buffered writer and releases its buffer back to the pool
+// it was acquired from. The writer must not be used after calling Close.
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.timer.Stop() {
+		w.armed = false
+	}
+
+	// mark as closed so a flush that already fired and is waiting on the
+	// mutex becomes a no-op instead of touching the buffer after it has been
+	// put back into the pool and possibly handed to another Writer
+	w.closed = true
+
+	err := w.writer.Flush()
+	if err != nil {
+		w.observeError(err)
+	}
+
+	if w.pool != nil {
+		w.pool.put(w.writer)
+	}
+
+	return err
+}
+
 // Write implements the io.Writer interface and writes data to the underlying
 // buffered writer and flushes it asynchronously.
 func (w *Writer) Write(p []byte) (int, error) {
+	if err := w.checkLimit(len(p)); err != nil {
+		return 0, err
+	}
+
+	w.throttle(len(p))
+
 	return w.write(p, false)
 }
 
@@ -103,9 +284,34 @@ func (w *Writer) Flush() error {
 // WriteAndFlush writes data to the underlying buffered writer and flushes it
 // immediately after writing.
 func (w *Writer) WriteAndFlush(p []byte) (int, error) {
+	if err := w.checkLimit(len(p)); err != nil {
+		return 0, err
+	}
+
+	w.throttle(len(p))
+
 	return w.write(p, true)
 }
 
+// WriteBuffers writes the contents of bufs to the underlying buffered writer
+// without concatenating them first and flushes it asynchronously. This is
+// useful for callers with a chain of framed payloads (e.g. headers, body and
+// trailer).
+//
+// Note: If the combined length exceeds the buffer size, bufs is written
+// directly to the target via net.Buffers.WriteTo, which consumes bufs by
+// zeroing its written slices; callers that need to reuse bufs afterwards
+// should pass a copy.
+func (w *Writer) WriteBuffers(bufs net.Buffers) (int64, error) {
+	return w.writeBuffers(bufs, false)
+}
+
+// WriteBuffersAndFlush writes the contents of bufs like WriteBuffers and
+// flushes immediately afterwards.
+func (w *Writer) WriteBuffersAndFlush(bufs net.Buffers) (int64, error) {
+	return w.writeBuffers(bufs, true)
+}
+
 // SetMaxDelay can be used to adjust the maximum delay of asynchronous flushes.
 //
 // Note: The delay should not be below 1ms to prevent flushing every write
@@ -114,6 +320,127 @@ func (w *Writer) SetMaxDelay(delay time.Duration) {
 	atomic.StoreInt64(&w.delay, int64(delay))
 }
 
+// CurrentDelay returns the flush delay currently in effect. For writers
+// created without WriterOptions.Adaptive this is just the configured max
+// delay; for adaptive writers it reflects the most recently tuned value.
+func (w *Writer) CurrentDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&w.delay))
+}
+
+// SetRateLimit enables a token-bucket rate limit that throttles Write and
+// WriteAndFlush so the underlying writer never exceeds the specified
+// throughput. The bucket is refilled continuously based on wall-clock time
+// and caps at burst bytes. A single call larger than burst only waits for
+// the bucket to fill up to burst rather than blocking indefinitely. Passing
+// a bytesPerSecond of zero disables the limit again.
+func (w *Writer) SetRateLimit(bytesPerSecond, burst int64) {
+	atomic.StoreInt64(&w.burst, burst)
+	atomic.StoreInt64(&w.tokens, burst)
+	atomic.StoreInt64(&w.last, time.Now().UnixNano())
+	atomic.StoreInt64(&w.rate, bytesPerSecond)
+}
+
+// SetByteLimit enables a hard cap on the total number of bytes that may be
+// written. Once the cap has been exceeded, Write and WriteAndFlush return
+// ErrLimitReached. Passing a limit of zero disables the cap again.
+func (w *Writer) SetByteLimit(limit int64) {
+	atomic.StoreInt64(&w.limit, limit)
+}
+
+// checkLimit enforces the hard byte limit, if any, and must be called before
+// the mutex is acquired so it never blocks the asynchronous flusher.
+func (w *Writer) checkLimit(n int) error {
+	limit := atomic.LoadInt64(&w.limit)
+	if limit <= 0 || n <= 0 {
+		return nil
+	}
+
+	if atomic.AddInt64(&w.used, int64(n)) > limit {
+		return ErrLimitReached
+	}
+
+	return nil
+}
+
+// throttle blocks the caller until enough tokens are available for n bytes.
+// It operates on atomics alone and must be called before the mutex is
+// acquired so it never blocks the asynchronous flusher.
+func (w *Writer) throttle(n int) {
+	rate := atomic.LoadInt64(&w.rate)
+	if rate <= 0 || n <= 0 {
+		return
+	}
+
+	// cap the debt of a single call at the burst size; tokens never
+	// accumulate past burst, so requiring more than that would block forever
+	if burst := atomic.LoadInt64(&w.burst); burst > 0 && int64(n) > burst {
+		n = int(burst)
+	}
+
+	for {
+		// refill the bucket based on the elapsed wall-clock time
+		last := atomic.LoadInt64(&w.last)
+		now := time.Now().UnixNano()
+		if elapsed := now - last; elapsed > 0 {
+			if atomic.CompareAndSwapInt64(&w.last, last, now) {
+				w.grantTokens(elapsed, rate)
+			}
+		}
+
+		// consume tokens if enough are available
+		tokens := atomic.LoadInt64(&w.tokens)
+		if tokens >= int64(n) {
+			if atomic.CompareAndSwapInt64(&w.tokens, tokens, tokens-int64(n)) {
+				return
+			}
+
+			continue
+		}
+
+		// sleep until enough tokens should have accumulated
+		wait := time.Duration((int64(n) - tokens) * int64(time.Second) / rate)
+		if wait <= 0 {
+			wait = time.Millisecond
+		}
+
+		time.Sleep(wait)
+	}
+}
+
+// grantTokens adds tokens earned over elapsed nanoseconds at rate bytes per
+// second, capped at burst. The cap is enforced via a CAS loop rather than an
+// unconditional store so a concurrent consumer's debit between our read and
+// write is never clobbered and handed back.
+func (w *Writer) grantTokens(elapsed, rate int64) {
+	// guard elapsed*rate against overflow for long gaps at high rates; once
+	// elapsed alone would already refill past any realistic burst, further
+	// precision doesn't matter since the result is clamped to burst below
+	const maxProduct = math.MaxInt64 / 2
+	cap := maxProduct / rate
+	if cap < 1 {
+		// elapsed*rate stays within int64 for a single nanosecond at any rate
+		cap = 1
+	}
+	if elapsed > cap {
+		elapsed = cap
+	}
+
+	gain := elapsed * rate / int64(time.Second)
+
+	for {
+		tokens := atomic.LoadInt64(&w.tokens)
+
+		next := tokens + gain
+		if burst := atomic.LoadInt64(&w.burst); next > burst {
+			next = burst
+		}
+
+		if atomic.CompareAndSwapInt64(&w.tokens, tokens, next) {
+			return
+		}
+	}
+}
+
 func (w *Writer) write(p []byte, flush bool) (n int, err error) {
 	// acquire mutex
 	w.mutex.Lock()
@@ -135,6 +462,7 @@ func (w *Writer) write(p []byte, flush bool) (n int, err error) {
 		// write data
 		n, err = w.writer.Write(p)
 		if err != nil {
+			w.observeError(err)
 			return n, err
 		}
 
@@ -143,16 +471,104 @@ func (w *Writer) write(p []byte, flush bool) (n int, err error) {
 		flushed = n > a
 	}
 
+	err = w.settle(flush, flushed)
+
+	return n, err
+}
+
+// writeBuffers writes the contents of bufs like write, but treats each
+// element like a separate write so the flushed flag is tracked correctly
+// across the whole chain. If the combined length exceeds the buffer size, any
+// already buffered data is flushed first and the remainder is written
+// directly to the target, letting net.Buffers perform a vectored write if the
+// target supports it.
+func (w *Writer) writeBuffers(bufs net.Buffers, flush bool) (total int64, err error) {
+	var size int
+	for _, buf := range bufs {
+		size += len(buf)
+	}
+
+	if err = w.checkLimit(size); err != nil {
+		return 0, err
+	}
+
+	w.throttle(size)
+
+	// acquire mutex
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// clear and return any error from flush
+	if w.err != nil {
+		err = w.err
+		w.err = nil
+		return 0, err
+	}
+
+	var flushed bool
+
+	if size > w.writer.Size() {
+		// flush any already buffered data before writing direct
+		if w.writer.Buffered() > 0 {
+			if err = w.writer.Flush(); err != nil {
+				w.observeError(err)
+				return 0, err
+			}
+		}
+
+		total, err = bufs.WriteTo(w.target)
+		if err != nil {
+			w.observeError(err)
+			return total, err
+		}
+
+		flushed = true
+	} else {
+		for _, buf := range bufs {
+			a := w.writer.Available()
+
+			n, werr := w.writer.Write(buf)
+			total += int64(n)
+
+			if n > a {
+				flushed = true
+			}
+
+			if werr != nil {
+				w.observeError(werr)
+				return total, werr
+			}
+		}
+	}
+
+	err = w.settle(flush, flushed)
+
+	return total, err
+}
+
+// settle flushes if requested and arms, cancels or extends the flush timer
+// based on the buffer state. It must be called with the mutex held.
+func (w *Writer) settle(flush, flushed bool) error {
 	// get delay
 	delay := time.Duration(atomic.LoadInt64(&w.delay))
 
 	// flush immediately if requested or delay is zero
 	if flush || delay == 0 {
-		err = w.writer.Flush()
-		if err != nil {
-			return n, err
+		bytes := w.writer.Buffered()
+
+		var observed time.Duration
+		if w.armed {
+			observed = time.Since(w.armedAt)
 		}
+
+		if err := w.writer.Flush(); err != nil {
+			w.observeError(err)
+			return err
+		}
+
 		flushed = true
+		w.observeFlush(observed, bytes)
+		w.adjustDelay(bytes)
 	}
 
 	// get buffered
@@ -161,47 +577,131 @@ func (w *Writer) write(p []byte, flush bool) (n int, err error) {
 	// arm timer if data is buffered
 	if buffered > 0 && !w.armed {
 		atomic.AddUint64(&initiated, 1)
+		atomic.AddUint64(&w.initiated, 1)
+		w.armedAt = time.Now()
 		w.timer.Reset(delay)
 		w.armed = true
 
-		return n, nil
+		if w.collector != nil {
+			w.collector.ObserveInitiate()
+		}
+
+		return nil
 	}
 
 	// clear timer if no data is buffered and the timer has not yet fired
 	if buffered == 0 && w.armed {
 		if w.timer.Stop() {
 			atomic.AddUint64(&cancelled, 1)
+			atomic.AddUint64(&w.cancelled, 1)
 			w.armed = false
+
+			if w.collector != nil {
+				w.collector.ObserveCancel()
+			}
 		}
 
-		return n, nil
+		return nil
 	}
 
 	// reset timer if data has been flushed and the timer has not yet fired
 	if flushed && w.armed {
 		if w.timer.Stop() {
 			atomic.AddUint64(&extended, 1)
+			atomic.AddUint64(&w.extended, 1)
+			w.armedAt = time.Now()
 			w.timer.Reset(delay)
+
+			if w.collector != nil {
+				w.collector.ObserveExtend()
+			}
+
+			// an extend only happens when the buffer filled up completely
+			// before the timer fired, so treat it as a full buffer for the
+			// purpose of the adaptive delay
+			w.adjustDelay(w.writer.Size())
 		}
 	}
 
-	return n, nil
+	return nil
 }
 
-func (w *Writer) flush() {
-	// count flush
-	atomic.AddUint64(&executed, 1)
+// adjustDelay tunes the flush delay based on the fill ratio observed at the
+// last flush, when adaptive mode is enabled. The delay is halved when the
+// buffer was mostly full (the timer is losing the race to incoming writes)
+// and grown by minDelay when it was mostly empty (the timer is firing too
+// eagerly), bounded by [minDelay, maxDelay].
+func (w *Writer) adjustDelay(bytes int) {
+	if !w.adaptive {
+		return
+	}
 
+	size := w.writer.Size()
+	if size <= 0 {
+		return
+	}
+
+	ratio := float64(bytes) / float64(size)
+	minDelay := atomic.LoadInt64(&w.minDelay)
+	maxDelay := atomic.LoadInt64(&w.maxDelay)
+
+	switch {
+	case ratio > 0.75:
+		if next := atomic.LoadInt64(&w.delay) / 2; next < minDelay {
+			atomic.StoreInt64(&w.delay, minDelay)
+		} else {
+			atomic.StoreInt64(&w.delay, next)
+		}
+	case ratio < 0.25:
+		if next := atomic.LoadInt64(&w.delay) + minDelay; next > maxDelay {
+			atomic.StoreInt64(&w.delay, maxDelay)
+		} else {
+			atomic.StoreInt64(&w.delay, next)
+		}
+	}
+}
+
+// observeFlush reports a flush event to the configured collector, if any.
+func (w *Writer) observeFlush(delay time.Duration, bytes int) {
+	if w.collector != nil {
+		w.collector.ObserveFlush(delay, bytes)
+	}
+}
+
+// observeError reports an error to the configured collector, if any.
+func (w *Writer) observeError(err error) {
+	if w.collector != nil {
+		w.collector.ObserveError(err)
+	}
+}
+
+func (w *Writer) flush() {
 	// acquire mutex
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
+	// bail out if the writer has been closed in the meantime; its buffer may
+	// already have been recycled by the pool
+	if w.closed {
+		return
+	}
+
+	// count flush
+	atomic.AddUint64(&executed, 1)
+	atomic.AddUint64(&w.executed, 1)
+
 	// set flag
 	w.armed = false
 
 	// flush buffer
+	bytes := w.writer.Buffered()
+	delay := time.Since(w.armedAt)
 	err := w.writer.Flush()
 	if err != nil && w.err == nil {
 		w.err = err
+		w.observeError(err)
 	}
+
+	w.observeFlush(delay, bytes)
+	w.adjustDelay(bytes)
 }
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -179,6 +181,272 @@ func TestWriterSetMaxDelay(t *testing.T) {
 	assert.Equal(t, Stats{Initiated: 1, Cancelled: 1}, s)
 }
 
+func TestWriterSetRateLimit(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriter(b, time.Millisecond)
+	w.SetRateLimit(1000, 10)
+
+	start := time.Now()
+
+	n, err := w.Write(make([]byte, 10))
+	assert.Equal(t, 10, n)
+	assert.NoError(t, err)
+
+	n, err = w.Write(make([]byte, 10))
+	assert.Equal(t, 10, n)
+	assert.NoError(t, err)
+
+	assert.True(t, time.Since(start) >= 9*time.Millisecond)
+}
+
+func TestWriterSetRateLimitOversizedWrite(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriter(b, time.Millisecond)
+	w.SetRateLimit(1000, 10)
+
+	done := make(chan struct{})
+	go func() {
+		n, err := w.Write(make([]byte, 11))
+		assert.Equal(t, 11, n)
+		assert.NoError(t, err)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("write larger than burst did not return")
+	}
+}
+
+func TestWriterThrottleRefillOverflow(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriter(b, time.Millisecond)
+	w.SetRateLimit(1<<62, 100)
+
+	// simulate a long idle gap so elapsed*rate would overflow int64 if
+	// computed without guarding
+	atomic.StoreInt64(&w.last, time.Now().Add(-time.Hour).UnixNano())
+
+	assert.NotPanics(t, func() {
+		n, err := w.Write(make([]byte, 10))
+		assert.Equal(t, 10, n)
+		assert.NoError(t, err)
+	})
+
+	assert.LessOrEqual(t, atomic.LoadInt64(&w.tokens), int64(100))
+}
+
+func TestWriterSetByteLimit(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriter(b, time.Millisecond)
+	w.SetByteLimit(10)
+
+	n, err := w.Write(make([]byte, 5))
+	assert.Equal(t, 5, n)
+	assert.NoError(t, err)
+
+	n, err = w.Write(make([]byte, 5))
+	assert.Equal(t, 5, n)
+	assert.NoError(t, err)
+
+	n, err = w.Write(make([]byte, 1))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, ErrLimitReached, err)
+}
+
+func TestWriterWriteBuffers(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriter(b, time.Millisecond)
+
+	n, err := w.WriteBuffers(net.Buffers{{1}, {2, 3}})
+	assert.Equal(t, int64(3), n)
+	assert.NoError(t, err)
+	assert.True(t, w.armed)
+
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Equal(t, []byte{1, 2, 3}, b.Bytes())
+	assert.False(t, w.armed)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, Stats{Initiated: 1, Executed: 1}, w.Stats())
+}
+
+func TestWriterWriteBuffersAndFlush(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriter(b, time.Millisecond)
+
+	n, err := w.WriteBuffersAndFlush(net.Buffers{{1}, {2, 3}})
+	assert.Equal(t, int64(3), n)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, b.Bytes())
+	assert.False(t, w.armed)
+}
+
+func TestWriterWriteBuffersDirect(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriterSize(b, time.Millisecond, 4)
+
+	n, err := w.WriteBuffers(net.Buffers{bytes.Repeat([]byte{1}, 3), bytes.Repeat([]byte{2}, 3)})
+	assert.Equal(t, int64(6), n)
+	assert.NoError(t, err)
+	assert.Equal(t, append(bytes.Repeat([]byte{1}, 3), bytes.Repeat([]byte{2}, 3)...), b.Bytes())
+}
+
+func TestWriterClose(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	pool := NewBufferPool()
+	w := NewWriterPooled(b, time.Millisecond, pool)
+
+	n, err := w.Write([]byte{1})
+	assert.Equal(t, 1, n)
+	assert.NoError(t, err)
+	assert.True(t, w.armed)
+
+	err = w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b.Bytes())
+	assert.False(t, w.armed)
+}
+
+func TestWriterCloseFlushRace(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriter(b, time.Hour)
+
+	n, err := w.Write([]byte{1})
+	assert.Equal(t, 1, n)
+	assert.NoError(t, err)
+
+	err = w.Close()
+	assert.NoError(t, err)
+
+	// simulate a timer-triggered flush that was already blocked on the mutex
+	// when Close ran; it must become a no-op instead of touching the buffer
+	// that has since been returned to the pool
+	w.flush()
+
+	assert.Equal(t, Stats{Initiated: 1}, w.Stats())
+}
+
+func TestWriterStats(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriter(b, time.Millisecond)
+
+	n, err := w.Write([]byte{1})
+	assert.Equal(t, 1, n)
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Initiated: 1}, w.Stats())
+
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Equal(t, Stats{Initiated: 1, Executed: 1}, w.Stats())
+}
+
+func TestWriterAdaptiveDelay(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriterWithOptions(b, WriterOptions{
+		MaxDelay: 800 * time.Millisecond,
+		MinDelay: 10 * time.Millisecond,
+		Size:     8,
+		Adaptive: true,
+	})
+	assert.Equal(t, 800*time.Millisecond, w.CurrentDelay())
+
+	// fill the buffer completely, then overflow it to force an internal flush
+	// while the timer is armed, simulating high fill pressure
+	n, err := w.Write(make([]byte, 8))
+	assert.Equal(t, 8, n)
+	assert.NoError(t, err)
+
+	n, err = w.Write([]byte{1})
+	assert.Equal(t, 1, n)
+	assert.NoError(t, err)
+	assert.Equal(t, 400*time.Millisecond, w.CurrentDelay())
+
+	// an explicit flush with little buffered data simulates low fill
+	// pressure and grows the delay again
+	err = w.Flush()
+	assert.NoError(t, err)
+	assert.Equal(t, 410*time.Millisecond, w.CurrentDelay())
+}
+
+func TestWriterAdaptiveDelayClampsMinDelay(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	w := NewWriterWithOptions(b, WriterOptions{
+		MaxDelay: 8 * time.Millisecond,
+		Size:     8,
+		Adaptive: true,
+	})
+
+	// repeatedly halving from a zero MinDelay would otherwise collapse the
+	// delay to zero and turn every write into a synchronous flush
+	for i := 0; i < 10; i++ {
+		n, err := w.Write(make([]byte, 8))
+		assert.Equal(t, 8, n)
+		assert.NoError(t, err)
+
+		n, err = w.Write([]byte{1})
+		assert.Equal(t, 1, n)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, time.Millisecond, w.CurrentDelay())
+
+	// flush synchronously so no armed timer is left to fire later and
+	// pollute the global stats observed by other tests
+	assert.NoError(t, w.Flush())
+}
+
+type testCollector struct {
+	initiated int
+	extended  int
+	cancelled int
+	flushes   int
+	errors    int
+}
+
+func (c *testCollector) ObserveInitiate() { c.initiated++ }
+func (c *testCollector) ObserveExtend()   { c.extended++ }
+func (c *testCollector) ObserveCancel()   { c.cancelled++ }
+
+func (c *testCollector) ObserveFlush(time.Duration, int) {
+	c.flushes++
+}
+
+func (c *testCollector) ObserveError(error) {
+	c.errors++
+}
+
+func TestWriterMetricsCollector(t *testing.T) {
+	b := new(bytes.Buffer)
+	collector := &testCollector{}
+
+	w := NewWriterWithOptions(b, WriterOptions{MaxDelay: time.Millisecond, Collector: collector})
+
+	n, err := w.Write([]byte{1})
+	assert.Equal(t, 1, n)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, collector.initiated)
+
+	err = w.Flush()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, collector.cancelled)
+	assert.Equal(t, 1, collector.flushes)
+}
+
 func TestWriterExtendedFlush(t *testing.T) {
 	s := GetStats()
 	b := new(bytes.Buffer)
@@ -384,3 +652,25 @@ func BenchmarkDiscard_32_1ns(b *testing.B) {
 		return NewWriter(ioutil.Discard, time.Nanosecond)
 	})
 }
+
+func BenchmarkNewWriterUnpooled(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		w := newWriter(ioutil.Discard, bufio.NewWriter(ioutil.Discard), time.Millisecond, nil, nil, false, 0)
+		_, _ = w.Write([]byte("x"))
+		_ = w.Flush()
+	}
+}
+
+func BenchmarkNewWriterPooled(b *testing.B) {
+	pool := NewBufferPool()
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		w := NewWriterPooled(ioutil.Discard, time.Millisecond, pool)
+		_, _ = w.Write([]byte("x"))
+		_ = w.Close()
+	}
+}
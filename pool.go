@@ -0,0 +1,70 @@
+package mercury
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// BufferPool maintains reusable *bufio.Writer buffers grouped by power-of-two
+// sizes. It lets applications that create many short-lived Writers (e.g. one
+// per connection in a server) avoid the resulting GC pressure.
+type BufferPool struct {
+	mutex sync.Mutex
+	pools map[int]*sync.Pool
+}
+
+// NewBufferPool creates and returns a new BufferPool.
+func NewBufferPool() *BufferPool {
+	return &BufferPool{
+		pools: map[int]*sync.Pool{},
+	}
+}
+
+// get returns a buffer of at least the requested size, reset to write to w.
+func (p *BufferPool) get(w io.Writer, size int) *bufio.Writer {
+	size = nextPowerOfTwo(size)
+
+	bw := p.pool(size).Get().(*bufio.Writer)
+	bw.Reset(w)
+
+	return bw
+}
+
+// put resets the buffer and returns it to the pool it was acquired from.
+func (p *BufferPool) put(bw *bufio.Writer) {
+	bw.Reset(ioutil.Discard)
+	p.pool(bw.Size()).Put(bw)
+}
+
+func (p *BufferPool) pool(size int) *sync.Pool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pool, ok := p.pools[size]
+	if !ok {
+		pool = &sync.Pool{
+			New: func() interface{} {
+				return bufio.NewWriterSize(ioutil.Discard, size)
+			},
+		}
+		p.pools[size] = pool
+	}
+
+	return pool
+}
+
+// nextPowerOfTwo rounds n up to the next power of two.
+func nextPowerOfTwo(n int) int {
+	if n <= 0 {
+		return 1
+	}
+
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+
+	return p
+}
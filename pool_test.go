@@ -0,0 +1,36 @@
+package mercury
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextPowerOfTwo(t *testing.T) {
+	assert.Equal(t, 1, nextPowerOfTwo(0))
+	assert.Equal(t, 1, nextPowerOfTwo(1))
+	assert.Equal(t, 2, nextPowerOfTwo(2))
+	assert.Equal(t, 4, nextPowerOfTwo(3))
+	assert.Equal(t, 4096, nextPowerOfTwo(4096))
+	assert.Equal(t, 8192, nextPowerOfTwo(4097))
+}
+
+func TestBufferPoolGetPut(t *testing.T) {
+	pool := NewBufferPool()
+
+	b1 := new(bytes.Buffer)
+	bw := pool.get(b1, 10)
+	assert.Equal(t, 16, bw.Size())
+
+	n, err := bw.Write([]byte("hello"))
+	assert.Equal(t, 5, n)
+	assert.NoError(t, err)
+
+	pool.put(bw)
+
+	b2 := new(bytes.Buffer)
+	bw2 := pool.get(b2, 10)
+	assert.Equal(t, 16, bw2.Size())
+	assert.Equal(t, 0, bw2.Buffered())
+}
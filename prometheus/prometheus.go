@@ -0,0 +1,108 @@
+// Package prometheus provides a mercury.MetricsCollector implementation that
+// exports flush latency and buffered-bytes metrics to Prometheus.
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/256dpi/mercury"
+)
+
+// Collector implements mercury.MetricsCollector and prometheus.Collector. It
+// exports a histogram of flush latencies and buffered bytes per flush, as
+// well as counters for the initiated/extended/cancelled/error events, making
+// it possible to tune a Writer's maxDelay from actual flush-timing
+// distributions.
+type Collector struct {
+	flushLatency  prometheus.Histogram
+	bufferedBytes prometheus.Histogram
+	initiated     prometheus.Counter
+	extended      prometheus.Counter
+	cancelled     prometheus.Counter
+	errors        prometheus.Counter
+}
+
+// NewCollector creates and returns a new Collector. The returned value
+// should be registered with a Prometheus registry and passed as the
+// Collector field of mercury.WriterOptions.
+func NewCollector(name string) *Collector {
+	return &Collector{
+		flushLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    name + "_flush_latency_seconds",
+			Help:    "The latency between arming the flush timer and the flush happening.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		bufferedBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    name + "_flush_buffered_bytes",
+			Help:    "The number of bytes written to the underlying writer per flush.",
+			Buckets: prometheus.ExponentialBuckets(64, 2, 10),
+		}),
+		initiated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: name + "_initiated_total",
+			Help: "The total number of armed flush timers.",
+		}),
+		extended: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: name + "_extended_total",
+			Help: "The total number of extended flush timers.",
+		}),
+		cancelled: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: name + "_cancelled_total",
+			Help: "The total number of cancelled flush timers.",
+		}),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: name + "_errors_total",
+			Help: "The total number of write and flush errors.",
+		}),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.flushLatency.Describe(ch)
+	c.bufferedBytes.Describe(ch)
+	c.initiated.Describe(ch)
+	c.extended.Describe(ch)
+	c.cancelled.Describe(ch)
+	c.errors.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.flushLatency.Collect(ch)
+	c.bufferedBytes.Collect(ch)
+	c.initiated.Collect(ch)
+	c.extended.Collect(ch)
+	c.cancelled.Collect(ch)
+	c.errors.Collect(ch)
+}
+
+// ObserveInitiate implements the mercury.MetricsCollector interface.
+func (c *Collector) ObserveInitiate() {
+	c.initiated.Inc()
+}
+
+// ObserveExtend implements the mercury.MetricsCollector interface.
+func (c *Collector) ObserveExtend() {
+	c.extended.Inc()
+}
+
+// ObserveCancel implements the mercury.MetricsCollector interface.
+func (c *Collector) ObserveCancel() {
+	c.cancelled.Inc()
+}
+
+// ObserveFlush implements the mercury.MetricsCollector interface.
+func (c *Collector) ObserveFlush(delay time.Duration, bytes int) {
+	c.flushLatency.Observe(delay.Seconds())
+	c.bufferedBytes.Observe(float64(bytes))
+}
+
+// ObserveError implements the mercury.MetricsCollector interface.
+func (c *Collector) ObserveError(error) {
+	c.errors.Inc()
+}
+
+var _ mercury.MetricsCollector = (*Collector)(nil)
+var _ prometheus.Collector = (*Collector)(nil)
@@ -0,0 +1,30 @@
+package prometheus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector("test")
+
+	c.ObserveInitiate()
+	c.ObserveExtend()
+	c.ObserveCancel()
+	c.ObserveFlush(10*time.Millisecond, 128)
+	c.ObserveError(errors.New("test"))
+
+	descs := make(chan *prometheus.Desc, 10)
+	c.Describe(descs)
+	close(descs)
+	assert.Len(t, descs, 6)
+
+	metrics := make(chan prometheus.Metric, 10)
+	c.Collect(metrics)
+	close(metrics)
+	assert.Len(t, metrics, 6)
+}
@@ -0,0 +1,215 @@
+package mercury
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIdle is returned by Read once no data has arrived within the configured
+// maximum idle duration.
+var ErrIdle = errors.New("idle")
+
+// ErrPeekUnavailable is returned by Peek once the idle-read fallback for
+// sources without a native read deadline has started, since its background
+// goroutine reads from the same underlying bufio.Reader.
+var ErrPeekUnavailable = errors.New("peek unavailable after idle fallback started")
+
+// fallbackBufSize is the size of the internal buffer used by the persistent
+// background reader started for sources without a native read deadline.
+const fallbackBufSize = 4096
+
+// Reader wraps a buffered reader and enforces a maximum idle duration on
+// Read. If no data arrives within that window, Read returns ErrIdle so
+// callers can e.g. flush an outbound Writer or send a keepalive. This mirrors
+// Writer and makes mercury usable as a full-duplex framing layer for
+// connection-oriented protocols.
+type Reader struct {
+	source io.Reader
+	reader *bufio.Reader
+	idle   int64
+
+	fallbackOnce    sync.Once
+	fallbackStarted int32
+	fallback        chan fallbackResult
+	fallbackBuf     []byte
+	fallbackErr     error
+}
+
+// fallbackResult carries the outcome of one read performed by the persistent
+// background reader used as a fallback on sources without SetReadDeadline.
+type fallbackResult struct {
+	data []byte
+	err  error
+}
+
+// NewReader wraps the provided reader and enables idle-timeout reads using
+// the specified maximum idle duration. A maxIdle of zero disables the
+// timeout.
+func NewReader(r io.Reader, maxIdle time.Duration) *Reader {
+	return newReader(r, bufio.NewReader(r), maxIdle)
+}
+
+// NewReaderSize wraps the provided reader and enables idle-timeout reads
+// using the specified maximum idle duration. This method allows
+// configuration of the initial buffer size.
+func NewReaderSize(r io.Reader, maxIdle time.Duration, size int) *Reader {
+	return newReader(r, bufio.NewReaderSize(r, size), maxIdle)
+}
+
+func newReader(source io.Reader, r *bufio.Reader, maxIdle time.Duration) *Reader {
+	return &Reader{
+		source: source,
+		reader: r,
+		idle:   int64(maxIdle),
+	}
+}
+
+// SetMaxIdle can be used to adjust the maximum idle duration. A maxIdle of
+// zero disables the timeout.
+func (r *Reader) SetMaxIdle(maxIdle time.Duration) {
+	atomic.StoreInt64(&r.idle, int64(maxIdle))
+}
+
+// Peek returns the next n bytes without advancing the reader.
+//
+// Note: Peek returns ErrPeekUnavailable once the idle-read fallback for
+// sources without a native read deadline has started (i.e. after the first
+// Read that needed it), since its background goroutine owns the underlying
+// bufio.Reader from that point on. Either call Peek before such a Read, or
+// use a source that implements SetReadDeadline (e.g. net.Conn), which never
+// starts the fallback.
+func (r *Reader) Peek(n int) ([]byte, error) {
+	if atomic.LoadInt32(&r.fallbackStarted) != 0 {
+		return nil, ErrPeekUnavailable
+	}
+
+	return r.reader.Peek(n)
+}
+
+// Read implements the io.Reader interface. If the configured maximum idle
+// duration elapses before any data arrives, it returns ErrIdle.
+func (r *Reader) Read(p []byte) (int, error) {
+	idle := time.Duration(atomic.LoadInt64(&r.idle))
+
+	// prefer a native read deadline if the wrapped reader supports one, e.g.
+	// net.Conn, since it avoids leaving a goroutine blocked on a stale read
+	if dr, ok := r.source.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return r.readDeadline(p, dr, idle)
+	}
+
+	return r.readFallback(p, idle)
+}
+
+// readDeadline implements Read for sources that support a native read
+// deadline.
+func (r *Reader) readDeadline(p []byte, dr interface{ SetReadDeadline(time.Time) error }, idle time.Duration) (int, error) {
+	if idle <= 0 {
+		// clear a deadline left over from a previous call; otherwise
+		// disabling the idle timeout would leave every subsequent read
+		// failing with a stale i/o timeout
+		if err := dr.SetReadDeadline(time.Time{}); err != nil {
+			return 0, err
+		}
+
+		return r.reader.Read(p)
+	}
+
+	if err := dr.SetReadDeadline(time.Now().Add(idle)); err != nil {
+		return 0, err
+	}
+
+	n, err := r.reader.Read(p)
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return n, ErrIdle
+	}
+
+	return n, err
+}
+
+// readFallback implements Read for sources without a native read deadline by
+// racing a persistent background reader against a timer. A single long-lived
+// goroutine is reused across calls instead of spawning one per Read, so
+// repeated idle timeouts don't leak goroutines.
+func (r *Reader) readFallback(p []byte, idle time.Duration) (int, error) {
+	// as long as the background reader has not been started yet, reads
+	// without a timeout can bypass it entirely; once it is running it owns
+	// the underlying bufio.Reader and every read, timed out or not, must go
+	// through it to avoid two goroutines reading it concurrently
+	if atomic.LoadInt32(&r.fallbackStarted) == 0 && idle <= 0 {
+		return r.reader.Read(p)
+	}
+
+	// serve bytes left over from a previous background read first, even
+	// past a sticky terminal error, so data delivered alongside it is never
+	// silently dropped
+	if len(r.fallbackBuf) > 0 {
+		n := copy(p, r.fallbackBuf)
+		r.fallbackBuf = r.fallbackBuf[n:]
+		return n, nil
+	}
+
+	if r.fallbackErr != nil {
+		return 0, r.fallbackErr
+	}
+
+	r.startFallback()
+
+	if idle <= 0 {
+		return r.deliverFallback(p, <-r.fallback)
+	}
+
+	select {
+	case res := <-r.fallback:
+		return r.deliverFallback(p, res)
+	case <-time.After(idle):
+		return 0, ErrIdle
+	}
+}
+
+// deliverFallback copies a background read result into p, stashing any
+// excess in fallbackBuf and remembering a terminal error as sticky.
+func (r *Reader) deliverFallback(p []byte, res fallbackResult) (int, error) {
+	n := copy(p, res.data)
+	if n < len(res.data) {
+		r.fallbackBuf = res.data[n:]
+	}
+
+	if res.err != nil {
+		r.fallbackErr = res.err
+	}
+
+	return n, res.err
+}
+
+// startFallback lazily starts the persistent background reader used to
+// implement idle timeouts (and, once running, all reads) on sources without
+// a native read deadline.
+func (r *Reader) startFallback() {
+	r.fallbackOnce.Do(func() {
+		r.fallback = make(chan fallbackResult, 1)
+		atomic.StoreInt32(&r.fallbackStarted, 1)
+
+		go func() {
+			buf := make([]byte, fallbackBufSize)
+			for {
+				n, err := r.reader.Read(buf)
+
+				data := make([]byte, n)
+				copy(data, buf[:n])
+
+				r.fallback <- fallbackResult{data: data, err: err}
+
+				if err != nil {
+					return
+				}
+			}
+		}()
+	})
+}
@@ -0,0 +1,215 @@
+package mercury
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderRead(t *testing.T) {
+	b := bytes.NewBufferString("hello")
+	r := NewReader(b, time.Second)
+
+	buf := make([]byte, 5)
+	n, err := r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestReaderPeek(t *testing.T) {
+	b := bytes.NewBufferString("hello")
+	r := NewReaderSize(b, time.Second, 16)
+
+	p, err := r.Peek(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("he"), p)
+
+	buf := make([]byte, 5)
+	n, err := r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+}
+
+func TestReaderIdle(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	r := NewReader(pr, 10*time.Millisecond)
+
+	buf := make([]byte, 5)
+	n, err := r.Read(buf)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, ErrIdle, err)
+}
+
+func TestReaderIdleThenData(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	r := NewReader(pr, 10*time.Millisecond)
+
+	buf := make([]byte, 5)
+	n, err := r.Read(buf)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, ErrIdle, err)
+
+	go func() {
+		_, _ = pw.Write([]byte("hello"))
+	}()
+
+	n, err = r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestReaderIdleFallbackPartialRead(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	r := NewReader(pr, 10*time.Millisecond)
+
+	go func() {
+		_, _ = pw.Write([]byte("hello"))
+	}()
+
+	buf := make([]byte, 3)
+	n, err := r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "hel", string(buf))
+
+	n, err = r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "lo", string(buf[:n]))
+}
+
+func TestReaderSetMaxIdle(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	r := NewReader(pr, time.Minute)
+	r.SetMaxIdle(10 * time.Millisecond)
+
+	buf := make([]byte, 5)
+	n, err := r.Read(buf)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, ErrIdle, err)
+}
+
+func TestReaderPeekUnavailableAfterFallbackStarted(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	r := NewReader(pr, 10*time.Millisecond)
+
+	buf := make([]byte, 5)
+	_, _ = r.Read(buf)
+
+	p, err := r.Peek(1)
+	assert.Nil(t, p)
+	assert.Equal(t, ErrPeekUnavailable, err)
+}
+
+func TestReaderSetMaxIdleZeroAfterFallbackStarted(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	r := NewReader(pr, 10*time.Millisecond)
+
+	buf := make([]byte, 5)
+	n, err := r.Read(buf)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, ErrIdle, err)
+
+	r.SetMaxIdle(0)
+
+	go func() {
+		_, _ = pw.Write([]byte("hello"))
+	}()
+
+	n, err = r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "hello", string(buf))
+}
+
+type recordingDeadlineReader struct {
+	r         io.Reader
+	deadlines []time.Time
+}
+
+func (f *recordingDeadlineReader) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+func (f *recordingDeadlineReader) SetReadDeadline(t time.Time) error {
+	f.deadlines = append(f.deadlines, t)
+	return nil
+}
+
+func TestReaderClearsDeadlineWhenIdleDisabled(t *testing.T) {
+	fr := &recordingDeadlineReader{r: bytes.NewBufferString("helloworld")}
+	r := NewReader(fr, time.Second)
+
+	buf := make([]byte, 5)
+	n, err := r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Len(t, fr.deadlines, 1)
+	assert.False(t, fr.deadlines[0].IsZero())
+
+	r.SetMaxIdle(0)
+
+	n, err = r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Len(t, fr.deadlines, 2)
+	assert.True(t, fr.deadlines[1].IsZero())
+}
+
+type dataThenEOFReader struct {
+	data []byte
+	done bool
+}
+
+func (d *dataThenEOFReader) Read(p []byte) (int, error) {
+	if d.done {
+		return 0, io.EOF
+	}
+
+	d.done = true
+	n := copy(p, d.data)
+
+	return n, io.EOF
+}
+
+func TestReaderFallbackDrainsBufferBeforeStickyError(t *testing.T) {
+	d := &dataThenEOFReader{data: []byte("hello")}
+	r := NewReader(d, time.Second)
+
+	buf := make([]byte, 2)
+	n, err := r.Read(buf)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "he", string(buf))
+
+	n, err = r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, "ll", string(buf))
+
+	n, err = r.Read(buf[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "o", string(buf[:1]))
+
+	n, err = r.Read(buf)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+}